@@ -0,0 +1,302 @@
+package elasticthought
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/couchbaselabs/logg"
+	"github.com/tleyden/go-couch"
+)
+
+// ExportSpec describes where a trained model's artifacts should be sent,
+// eg `{"type":"tar","attrs":{"dest":"/out/model.tgz"}}`.  Solver.Exports is
+// a list of these, parsed straight off the incoming request JSON.
+type ExportSpec struct {
+	Type  string            `json:"type"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+// ArtifactExporter pushes a directory of trained model artifacts (snapshot
+// .caffemodel, prototxt, label index) somewhere once training completes.
+type ArtifactExporter interface {
+	Export(solver Solver, artifactDir string) error
+}
+
+// exporterForSpec builds the ArtifactExporter described by spec.
+func exporterForSpec(spec ExportSpec) (ArtifactExporter, error) {
+
+	switch spec.Type {
+	case "cbfs", "":
+		return cbfsExporter{}, nil
+	case "tar":
+		dest, ok := spec.Attrs["dest"]
+		if !ok {
+			return nil, fmt.Errorf("tar exporter requires a dest attr")
+		}
+		return tarExporter{dest: dest}, nil
+	case "local":
+		dest, ok := spec.Attrs["dest"]
+		if !ok {
+			return nil, fmt.Errorf("local exporter requires a dest attr")
+		}
+		return localExporter{dest: dest}, nil
+	case "http":
+		url, ok := spec.Attrs["url"]
+		if !ok {
+			return nil, fmt.Errorf("http exporter requires a url attr")
+		}
+		return httpExporter{url: url, secret: spec.Attrs["secret"]}, nil
+	default:
+		return nil, fmt.Errorf("unknown export type: %v", spec.Type)
+	}
+
+}
+
+// ExportArtifacts fans the contents of artifactDir out to every exporter
+// configured on the solver.  If no exports were configured, it falls back
+// to the historical behavior of writing to cbfs under <solver-id>/...
+func (s Solver) ExportArtifacts(artifactDir string) error {
+
+	specs := s.Exports
+	if len(specs) == 0 {
+		specs = []ExportSpec{{Type: "cbfs"}}
+	}
+
+	for _, spec := range specs {
+		exporter, err := exporterForSpec(spec)
+		if err != nil {
+			return fmt.Errorf("Error building exporter for %v: %w", spec, err)
+		}
+		if err := exporter.Export(s, artifactDir); err != nil {
+			return fmt.Errorf("Error exporting %v via %v: %w", artifactDir, spec.Type, err)
+		}
+		logg.LogTo("TRAINING_JOB", "Exported %v via %v", artifactDir, spec.Type)
+	}
+
+	return nil
+
+}
+
+// ExportTrainedArtifacts runs ExportArtifacts and transitions the solver to
+// StateExporting, unless it's already past that state (eg, on a resumed
+// job), in which case it's a no-op.
+func (s *Solver) ExportTrainedArtifacts(db couch.Database, artifactDir string) error {
+
+	if s.isPast(StateExporting) {
+		logg.LogTo("TRAINING_JOB", "Solver %v already past %v, skipping export", s.Id, StateExporting)
+		return nil
+	}
+
+	if err := s.ExportArtifacts(artifactDir); err != nil {
+		s.transitionState(db, StateFailed, err.Error())
+		return err
+	}
+
+	return s.transitionState(db, StateExporting, "")
+
+}
+
+// cbfsExporter writes the artifact tree to cbfs under <solver-id>/..., the
+// behavior that already existed before pluggable exporters.
+type cbfsExporter struct{}
+
+func (e cbfsExporter) Export(solver Solver, artifactDir string) error {
+
+	cbfs, err := solver.Configuration.NewCbfsClient()
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(artifactDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(artifactDir, p)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		destPath := fmt.Sprintf("%v/%v", solver.Id, rel)
+		return solver.saveToCbfs(cbfs, destPath, f)
+	})
+
+}
+
+// tarExporter streams the artifact tree into a single gzipped tar at dest.
+type tarExporter struct {
+	dest string
+}
+
+func (e tarExporter) Export(solver Solver, artifactDir string) (err error) {
+
+	out, err := os.Create(e.dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gzw := gzip.NewWriter(out)
+	defer func() {
+		if cerr := gzw.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	tw := tar.NewWriter(gzw)
+	defer func() {
+		if cerr := tw.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	err = filepath.Walk(artifactDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(artifactDir, p)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+
+	return err
+
+}
+
+// localExporter writes the artifact tree to a local directory, useful for
+// CLI/dev workflows that don't want to stand up cbfs.
+type localExporter struct {
+	dest string
+}
+
+func (e localExporter) Export(solver Solver, artifactDir string) error {
+
+	return filepath.Walk(artifactDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(artifactDir, p)
+		if err != nil {
+			return err
+		}
+
+		destPath := filepath.Join(e.dest, rel)
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := os.Create(destPath)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		_, err = io.Copy(dst, src)
+		return err
+	})
+
+}
+
+// httpExporter tars the artifact tree up and POSTs it to a webhook url,
+// HMAC-signing the body with secret (if set) so the receiver can verify it
+// came from this service.
+type httpExporter struct {
+	url    string
+	secret string
+}
+
+func (e httpExporter) Export(solver Solver, artifactDir string) error {
+
+	tmpFile, err := os.CreateTemp("", "elastic-thought-export-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if err := (tarExporter{dest: tmpFile.Name()}).Export(solver, artifactDir); err != nil {
+		return err
+	}
+
+	body, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+
+	if e.secret != "" {
+		mac := hmac.New(sha256.New, []byte(e.secret))
+		mac.Write(body)
+		req.Header.Set("X-ElasticThought-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%v response pushing export to %v", resp.StatusCode, e.url)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,167 @@
+package elasticthought
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeArtifactTree(t *testing.T, dir string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, "snapshot.caffemodel"), []byte("weights"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "nested", "labels.txt"), []byte("cat\ndog\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// readTarGz reads a gzipped tar at path into a map of entry name to contents.
+func readTarGz(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	defer gzr.Close()
+
+	entries := map[string]string{}
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar.Next: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		entries[hdr.Name] = string(content)
+	}
+	return entries
+}
+
+func TestTarExporterRoundTrip(t *testing.T) {
+	artifactDir := t.TempDir()
+	writeArtifactTree(t, artifactDir)
+
+	dest := filepath.Join(t.TempDir(), "model.tar.gz")
+	exporter := tarExporter{dest: dest}
+	if err := exporter.Export(Solver{}, artifactDir); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	entries := readTarGz(t, dest)
+	if entries["snapshot.caffemodel"] != "weights" {
+		t.Fatalf("expected snapshot.caffemodel content, got entries %v", entries)
+	}
+	if entries["nested/labels.txt"] != "cat\ndog\n" {
+		t.Fatalf("expected nested/labels.txt content, got entries %v", entries)
+	}
+}
+
+func TestLocalExporterCopiesTree(t *testing.T) {
+	artifactDir := t.TempDir()
+	writeArtifactTree(t, artifactDir)
+
+	dest := t.TempDir()
+	exporter := localExporter{dest: dest}
+	if err := exporter.Export(Solver{}, artifactDir); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dest, "snapshot.caffemodel"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "weights" {
+		t.Fatalf("unexpected content: %v", string(content))
+	}
+
+	nestedContent, err := os.ReadFile(filepath.Join(dest, "nested", "labels.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile nested: %v", err)
+	}
+	if string(nestedContent) != "cat\ndog\n" {
+		t.Fatalf("unexpected nested content: %v", string(nestedContent))
+	}
+}
+
+func TestHttpExporterSignsAndPostsTar(t *testing.T) {
+	artifactDir := t.TempDir()
+	writeArtifactTree(t, artifactDir)
+
+	const secret = "shh"
+
+	var gotBody []byte
+	var gotSignature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("ReadAll request body: %v", err)
+		}
+		gotBody = body
+		gotSignature = r.Header.Get("X-ElasticThought-Signature")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	exporter := httpExporter{url: server.URL, secret: secret}
+	if err := exporter.Export(Solver{}, artifactDir); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(gotBody)
+	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+	if gotSignature != expectedSignature {
+		t.Fatalf("expected signature %v, got %v", expectedSignature, gotSignature)
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(gotBody))
+	if err != nil {
+		t.Fatalf("posted body is not gzip: %v", err)
+	}
+	defer gzr.Close()
+
+	foundSnapshot := false
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar.Next: %v", err)
+		}
+		if hdr.Name == "snapshot.caffemodel" {
+			foundSnapshot = true
+		}
+	}
+	if !foundSnapshot {
+		t.Fatalf("expected posted tar to contain snapshot.caffemodel")
+	}
+}
@@ -0,0 +1,184 @@
+// Package cbfsfs adapts a cbfs client to the standard io/fs.FS interface,
+// so the rest of the codebase can walk, read and copy CBFS-backed paths
+// with fs.WalkDir, fs.ReadFile and io.Copy the same way it would against a
+// local directory.
+package cbfsfs
+
+import (
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"io/fs"
+
+	"github.com/tleyden/cbfs/client"
+)
+
+// backend is the minimal surface of a cbfs client that FS needs.  It exists
+// so tests can exercise FS against a fake instead of a real cbfs cluster.
+type backend interface {
+	Get(path string) (io.ReadCloser, error)
+	List(path string) (cbfsclient.ListResult, error)
+}
+
+// FS wraps a *cbfsclient.Client and implements fs.FS, fs.ReadDirFS and
+// fs.StatFS on top of it.
+type FS struct {
+	backend backend
+}
+
+// New wraps an existing cbfs client in an fs.FS.
+func New(client *cbfsclient.Client) *FS {
+	return &FS{backend: clientBackend{client}}
+}
+
+// clientBackend adapts a *cbfsclient.Client to the backend interface.
+type clientBackend struct {
+	client *cbfsclient.Client
+}
+
+func (b clientBackend) Get(path string) (io.ReadCloser, error) {
+	return b.client.Get(path)
+}
+
+func (b clientBackend) List(path string) (cbfsclient.ListResult, error) {
+	return b.client.List(path)
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	reader, err := f.backend.Get(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &file{name: path.Base(name), reader: reader}, nil
+}
+
+// Stat implements fs.StatFS.
+//
+// cbfs has no notion of a real directory -- a "directory" is just a path
+// prefix that happens to have objects under it.  So if name isn't itself an
+// object, Stat falls back to checking whether List returns anything under it
+// before giving up; this is what lets fs.WalkDir start from a directory
+// root.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	opened, err := f.Open(name)
+	if err == nil {
+		defer opened.Close()
+		return opened.Stat()
+	}
+
+	if entries, derr := f.ReadDir(name); derr == nil && len(entries) > 0 {
+		return dirInfo{name: path.Base(name)}, nil
+	}
+
+	return nil, err
+}
+
+// ReadDir implements fs.ReadDirFS by listing the immediate cbfs directories
+// and files below name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	listPath := name
+	if listPath == "." {
+		listPath = ""
+	}
+
+	listing, err := f.backend.List(listPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(listing.Dirs)+len(listing.Files))
+	for childName := range listing.Dirs {
+		entries = append(entries, dirEntry{name: childName, isDir: true})
+	}
+	for childName, meta := range listing.Files {
+		entries = append(entries, dirEntry{name: childName, isDir: false, size: meta.Length})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+// file adapts the io.ReadCloser returned by cbfsclient.Get to fs.File.
+type file struct {
+	name   string
+	reader io.ReadCloser
+}
+
+func (fl *file) Stat() (fs.FileInfo, error) { return fileInfo{name: fl.name}, nil }
+func (fl *file) Read(p []byte) (int, error) { return fl.reader.Read(p) }
+func (fl *file) Close() error               { return fl.reader.Close() }
+
+// fileInfo is a minimal fs.FileInfo for a CBFS object. CBFS does not expose
+// size or mtime on a plain Get, so those are left at their zero values.
+type fileInfo struct {
+	name string
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return 0 }
+func (fi fileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// dirInfo is the fs.FileInfo Stat returns for a path that isn't itself an
+// object but has objects listed under it.
+type dirInfo struct {
+	name string
+}
+
+func (di dirInfo) Name() string       { return di.name }
+func (di dirInfo) Size() int64        { return 0 }
+func (di dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (di dirInfo) ModTime() time.Time { return time.Time{} }
+func (di dirInfo) IsDir() bool        { return true }
+func (di dirInfo) Sys() interface{}   { return nil }
+
+// dirEntry implements fs.DirEntry for an entry discovered via FS.ReadDir.
+type dirEntry struct {
+	name  string
+	isDir bool
+	size  int64
+}
+
+func (de dirEntry) Name() string { return de.name }
+func (de dirEntry) IsDir() bool  { return de.isDir }
+
+func (de dirEntry) Type() fs.FileMode {
+	if de.isDir {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (de dirEntry) Info() (fs.FileInfo, error) {
+	mode := fs.FileMode(0444)
+	if de.isDir {
+		mode |= fs.ModeDir
+	}
+	return dirEntryInfo{dirEntry: de, mode: mode}, nil
+}
+
+// dirEntryInfo is the fs.FileInfo counterpart of a dirEntry.
+type dirEntryInfo struct {
+	dirEntry
+	mode fs.FileMode
+}
+
+func (di dirEntryInfo) Size() int64        { return di.size }
+func (di dirEntryInfo) Mode() fs.FileMode  { return di.mode }
+func (di dirEntryInfo) ModTime() time.Time { return time.Time{} }
+func (di dirEntryInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,168 @@
+package cbfsfs
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tleyden/cbfs/client"
+)
+
+// fakeBackend is an in-memory stand-in for a cbfs client, keyed by path.
+type fakeBackend struct {
+	files map[string]string
+}
+
+func (b fakeBackend) Get(path string) (io.ReadCloser, error) {
+	content, ok := b.files[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+// List mimics cbfsclient.Client.List's depth-1 behavior: it reports only
+// the immediate children of path, splitting them into directories (which
+// have further path components below them) and files (which don't).
+func (b fakeBackend) List(path string) (cbfsclient.ListResult, error) {
+	prefix := path
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	result := cbfsclient.ListResult{
+		Dirs:  map[string]cbfsclient.Dir{},
+		Files: map[string]cbfsclient.FileMeta{},
+	}
+
+	for p, content := range b.files {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(p, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			result.Dirs[rest[:i]] = cbfsclient.Dir{}
+		} else {
+			result.Files[rest] = cbfsclient.FileMeta{Length: int64(len(content))}
+		}
+	}
+
+	return result, nil
+}
+
+func newTestFS(files map[string]string) *FS {
+	return &FS{backend: fakeBackend{files: files}}
+}
+
+func TestOpenReadsFileContent(t *testing.T) {
+	fsys := newTestFS(map[string]string{
+		"solver-id/solver.prototxt": "net: \"solver-net.prototxt\"",
+	})
+
+	content, err := fs.ReadFile(fsys, "solver-id/solver.prototxt")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != "net: \"solver-net.prototxt\"" {
+		t.Fatalf("unexpected content: %v", string(content))
+	}
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	fsys := newTestFS(map[string]string{})
+
+	if _, err := fsys.Open("does-not-exist.txt"); err == nil {
+		t.Fatalf("expected an error opening a missing file")
+	}
+}
+
+func TestStat(t *testing.T) {
+	fsys := newTestFS(map[string]string{
+		"solver-id/solver.prototxt": "abc",
+	})
+
+	info, err := fsys.Stat("solver-id/solver.prototxt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Name() != "solver.prototxt" {
+		t.Fatalf("expected name solver.prototxt, got %v", info.Name())
+	}
+}
+
+func TestStatDirectoryFallback(t *testing.T) {
+	fsys := newTestFS(map[string]string{
+		"dataset-id/training-data/Q/a.png": "x",
+	})
+
+	info, err := fsys.Stat("dataset-id")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if !info.IsDir() {
+		t.Fatalf("expected dataset-id to stat as a directory")
+	}
+}
+
+func TestReadDirCollapsesChildren(t *testing.T) {
+	fsys := newTestFS(map[string]string{
+		"dataset-id/training-data/Q/a.png": "x",
+		"dataset-id/training-data/R/b.png": "y",
+		"dataset-id/toc.txt":               "z",
+	})
+
+	entries, err := fsys.ReadDir("dataset-id")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+
+	expected := []string{"toc.txt", "training-data"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected entries %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected entries %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestWalkDirRoundTrip(t *testing.T) {
+	fsys := newTestFS(map[string]string{
+		"dataset-id/training-data/Q/a.png": "x",
+		"dataset-id/training-data/R/b.png": "y",
+	})
+
+	var seen []string
+	err := fs.WalkDir(fsys, "dataset-id", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			seen = append(seen, p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+
+	sort.Strings(seen)
+	expected := []string{"dataset-id/training-data/Q/a.png", "dataset-id/training-data/R/b.png"}
+	if len(seen) != len(expected) {
+		t.Fatalf("expected to walk %v, got %v", expected, seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Fatalf("expected to walk %v, got %v", expected, seen)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package elasticthought
 
 import (
-	"errors"
 	"fmt"
+	"io/fs"
 
 	"github.com/couchbaselabs/logg"
 	"github.com/tleyden/cbfs/client"
+	"github.com/tleyden/elastic-thought/cbfsfs"
+	"github.com/tleyden/elastic-thought/errs"
 	"github.com/tleyden/go-couch"
 )
 
@@ -48,7 +50,7 @@ func NewDefaultConfiguration() *Configuration {
 func (c Configuration) DbConnection() couch.Database {
 	db, err := couch.Connect(c.DbUrl)
 	if err != nil {
-		err = errors.New(fmt.Sprintf("Error %v | dbUrl: %v", err, c.DbUrl))
+		err = fmt.Errorf("Error connecting to dbUrl: %v : %w", c.DbUrl, err)
 		logg.LogPanic("%v", err)
 	}
 	return db
@@ -56,5 +58,20 @@ func (c Configuration) DbConnection() couch.Database {
 
 // Create a new cbfs client based on url stored in config
 func (c Configuration) NewCbfsClient() (*cbfsclient.Client, error) {
-	return cbfsclient.New(c.CbfsUrl)
+	client, err := cbfsclient.New(c.CbfsUrl)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %v", errs.ErrCbfsUnavailable, err)
+	}
+	return client, nil
+}
+
+// Create a new fs.FS backed by cbfs, based on url stored in config.  This
+// lets callers use fs.WalkDir, fs.ReadFile, io.Copy, etc against cbfs the
+// same way they would against a local directory.
+func (c Configuration) NewCbfsFS() (fs.FS, error) {
+	client, err := c.NewCbfsClient()
+	if err != nil {
+		return nil, err
+	}
+	return cbfsfs.New(client), nil
 }
@@ -0,0 +1,32 @@
+// Package errs holds sentinel errors shared across the elasticthought
+// package, so callers can use errors.Is/errors.As instead of pattern
+// matching on error strings.
+//
+// NOTE: the REST handler layer that should map these sentinels to HTTP
+// status codes (404 for ErrSpecNotFound/ErrDatasetArtifactMissing, 502 for
+// ErrCbfsUnavailable, 400 for ErrInvalidCbfsURI) is not part of this chunk
+// of the codebase, so that mapping is deferred rather than done here.
+package errs
+
+import "errors"
+
+var (
+	// ErrSpecNotFound means a solver's prototxt spec could not be found at
+	// its expected path in cbfs.
+	ErrSpecNotFound = errors.New("solver spec not found in cbfs")
+
+	// ErrCbfsUnavailable means the cbfs cluster could not be reached.
+	ErrCbfsUnavailable = errors.New("cbfs cluster unreachable")
+
+	// ErrPrototxtParse means a prototxt spec could not be parsed as a caffe
+	// protobuf message.
+	ErrPrototxtParse = errors.New("failed to parse prototxt")
+
+	// ErrDatasetArtifactMissing means a dataset's training or testing
+	// artifact could not be found in cbfs.
+	ErrDatasetArtifactMissing = errors.New("dataset artifact missing in cbfs")
+
+	// ErrInvalidCbfsURI means a url was expected to be a cbfs:// uri but
+	// wasn't.
+	ErrInvalidCbfsURI = errors.New("invalid cbfs uri")
+)
@@ -0,0 +1,130 @@
+package elasticthought
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/couchbaselabs/logg"
+	"github.com/tleyden/go-couch"
+)
+
+// JobState is a step in the training-job pipeline, persisted on the Solver
+// document so a worker that dies mid-job can resume instead of restarting
+// from scratch.
+type JobState int
+
+const (
+	StatePending JobState = iota
+	StateStagingData
+	StateRewritingSpecs
+	StateTraining
+	StateExporting
+	StateComplete
+	StateFailed
+)
+
+func (js JobState) String() string {
+	switch js {
+	case StatePending:
+		return "pending"
+	case StateStagingData:
+		return "staging-data"
+	case StateRewritingSpecs:
+		return "rewriting-specs"
+	case StateTraining:
+		return "training"
+	case StateExporting:
+		return "exporting"
+	case StateComplete:
+		return "complete"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// jobStateOrder ranks the states that are genuinely sequential, so a
+// persisted state can be compared against a target step to decide whether
+// that step's work has already happened.  StateStagingData and
+// StateRewritingSpecs are deliberately NOT ranked against each other here:
+// nothing guarantees SaveTrainTestData runs before (or after)
+// DownloadSpecToCbfs, so a single total order across them would let
+// isPast(StateStagingData) return true once a job had only rewritten specs,
+// skipping the actual data staging.  Those two steps gate their resume
+// short-circuit on their own persisted booleans instead -- see
+// Solver.StagedTrainTestData / Solver.RewroteSpecs.
+var jobStateOrder = map[JobState]int{
+	StatePending:   0,
+	StateTraining:  1,
+	StateExporting: 2,
+	StateComplete:  3,
+}
+
+// StateTransition records one move in the training-job state machine.
+type StateTransition struct {
+	Timestamp time.Time `json:"timestamp"`
+	From      JobState  `json:"from"`
+	To        JobState  `json:"to"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// isPast returns true if the solver's persisted state is already at or
+// beyond target, meaning the step that produces target has already run.
+// Only valid for states in jobStateOrder -- see the comment there for why
+// StateStagingData and StateRewritingSpecs are excluded and gated on their
+// own booleans instead.
+func (s Solver) isPast(target JobState) bool {
+	return jobStateOrder[s.State] >= jobStateOrder[target]
+}
+
+// transitionState advances the solver to the given state, appending a
+// StateTransition to its history and persisting the change to db.  If
+// another writer raced us and Save comes back with a 409, it reloads the
+// latest revision and retries.
+func (s *Solver) transitionState(db couch.Database, to JobState, message string) error {
+
+	const maxAttempts = 5
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+
+		from := s.State
+		s.State = to
+		s.StateHistory = append(s.StateHistory, StateTransition{
+			Timestamp: time.Now(),
+			From:      from,
+			To:        to,
+			Message:   message,
+		})
+
+		saved, err := s.Save(db)
+		if err == nil {
+			*s = *saved
+			logg.LogTo("TRAINING_JOB", "Solver %v: %v -> %v (%v)", s.Id, from, to, message)
+			return nil
+		}
+
+		if !isConflictError(err) {
+			return fmt.Errorf("Error transitioning solver %v to %v: %w", s.Id, to, err)
+		}
+
+		logg.LogTo("TRAINING_JOB", "Solver %v: 409 transitioning to %v, reloading and retrying", s.Id, to)
+		latest := &Solver{}
+		if rerr := db.Retrieve(s.Id, latest); rerr != nil {
+			return fmt.Errorf("Error reloading solver %v after 409: %w", s.Id, rerr)
+		}
+		*s = *latest
+
+	}
+
+	return fmt.Errorf("Error transitioning solver %v to %v: exhausted %v attempts on repeated 409s", s.Id, to, maxAttempts)
+
+}
+
+func isConflictError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "409")
+}
@@ -0,0 +1,132 @@
+package elasticthought
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tleyden/go-couch"
+)
+
+// fakeCouch emulates just enough of CouchDB's REST API (PUT to edit, GET to
+// retrieve) for transitionState's Save/Retrieve round trip, including
+// returning a 409 on command.
+type fakeCouch struct {
+	rev           int
+	conflictsLeft int
+	stored        Solver
+}
+
+func newFakeCouchServer(fc *fakeCouch) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+			if fc.conflictsLeft > 0 {
+				fc.conflictsLeft--
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			var doc Solver
+			if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fc.rev++
+			doc.Rev = strconv.Itoa(fc.rev)
+			fc.stored = doc
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok":  true,
+				"id":  doc.Id,
+				"rev": strconv.Itoa(fc.rev),
+			})
+		case "GET":
+			id := strings.TrimPrefix(r.URL.Path, "/testdb/")
+			doc := fc.stored
+			if doc.Id == "" {
+				doc = Solver{ElasticThoughtDoc: ElasticThoughtDoc{Id: id, Rev: strconv.Itoa(fc.rev)}}
+			}
+			json.NewEncoder(w).Encode(doc)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func testDatabase(t *testing.T, server *httptest.Server) couch.Database {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	return couch.Database{Scheme: u.Scheme, Host: u.Hostname(), Port: u.Port(), Name: "testdb"}
+}
+
+func TestTransitionStateSuccess(t *testing.T) {
+	fc := &fakeCouch{rev: 1}
+	server := newFakeCouchServer(fc)
+	defer server.Close()
+	db := testDatabase(t, server)
+
+	s := &Solver{ElasticThoughtDoc: ElasticThoughtDoc{Id: "solver-1", Rev: "1"}, State: StatePending}
+	if err := s.transitionState(db, StateTraining, "started"); err != nil {
+		t.Fatalf("transitionState: %v", err)
+	}
+	if s.State != StateTraining {
+		t.Fatalf("expected state %v, got %v", StateTraining, s.State)
+	}
+	if len(s.StateHistory) == 0 {
+		t.Fatalf("expected a recorded state transition")
+	}
+}
+
+func TestTransitionStateRetriesOnConflict(t *testing.T) {
+	fc := &fakeCouch{rev: 1, conflictsLeft: 2}
+	server := newFakeCouchServer(fc)
+	defer server.Close()
+	db := testDatabase(t, server)
+
+	s := &Solver{ElasticThoughtDoc: ElasticThoughtDoc{Id: "solver-1", Rev: "1"}, State: StatePending}
+	if err := s.transitionState(db, StateTraining, "started"); err != nil {
+		t.Fatalf("transitionState: %v", err)
+	}
+	if s.State != StateTraining {
+		t.Fatalf("expected state %v, got %v", StateTraining, s.State)
+	}
+}
+
+func TestTransitionStateExhaustsRetries(t *testing.T) {
+	fc := &fakeCouch{rev: 1, conflictsLeft: 1000}
+	server := newFakeCouchServer(fc)
+	defer server.Close()
+	db := testDatabase(t, server)
+
+	s := &Solver{ElasticThoughtDoc: ElasticThoughtDoc{Id: "solver-1", Rev: "1"}, State: StatePending}
+	err := s.transitionState(db, StateTraining, "started")
+	if err == nil {
+		t.Fatalf("expected an error after exhausting retries")
+	}
+	if !strings.Contains(err.Error(), "exhausted") {
+		t.Fatalf("expected an exhausted-attempts error, got %v", err)
+	}
+}
+
+func TestIsConflictError(t *testing.T) {
+	fc := &fakeCouch{rev: 1, conflictsLeft: 1}
+	server := newFakeCouchServer(fc)
+	defer server.Close()
+	db := testDatabase(t, server)
+
+	s := Solver{ElasticThoughtDoc: ElasticThoughtDoc{Id: "solver-1", Rev: "1"}}
+	_, err := s.Save(db)
+	if err == nil {
+		t.Fatalf("expected a 409 error from Save")
+	}
+	if !isConflictError(err) {
+		t.Fatalf("expected isConflictError to recognize a 409, got %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path"
@@ -15,6 +16,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/tleyden/cbfs/client"
 	"github.com/tleyden/elastic-thought/caffe"
+	"github.com/tleyden/elastic-thought/errs"
 	"github.com/tleyden/go-couch"
 )
 
@@ -25,6 +27,28 @@ type Solver struct {
 	SpecificationUrl    string `json:"specification-url" binding:"required"`
 	SpecificationNetUrl string `json:"specification-net-url" binding:"required"`
 
+	// Where to send trained model artifacts once training completes.  If
+	// empty, defaults to the historical behavior of writing to cbfs under
+	// <solver-id>/...
+	Exports []ExportSpec `json:"exports,omitempty"`
+
+	// Current step in the training-job pipeline, and the history of how it
+	// got there.  Lets a worker that died mid-job resume instead of
+	// restarting from scratch.
+	State        JobState          `json:"state,omitempty"`
+	StateHistory []StateTransition `json:"state-history,omitempty"`
+
+	// RewroteSpecs and StagedTrainTestData track completion of those two
+	// steps independently of State/jobStateOrder, since neither is known to
+	// run before the other -- see the comment on jobStateOrder.
+	RewroteSpecs        bool `json:"rewrote-specs,omitempty"`
+	StagedTrainTestData bool `json:"staged-train-test-data,omitempty"`
+
+	// Label index computed while staging train/test data, persisted here so
+	// a resumed job doesn't have to re-untar the cbfs artifacts to recompute
+	// it.
+	TrainingLabelIndex []string `json:"training-label-index,omitempty"`
+
 	// had to make exported, due to https://github.com/gin-gonic/gin/pull/123
 	// waiting for this to get merged into master branch, since go get
 	// pulls from master branch.
@@ -46,7 +70,7 @@ func (s Solver) Insert(db couch.Database) (*Solver, error) {
 
 	id, _, err := db.Insert(s)
 	if err != nil {
-		err := fmt.Errorf("Error inserting solver: %v.  Err: %v", s, err)
+		err := fmt.Errorf("Error inserting solver: %v : %w", s, err)
 		return nil, err
 	}
 
@@ -54,7 +78,7 @@ func (s Solver) Insert(db couch.Database) (*Solver, error) {
 	solver := &Solver{}
 	err = db.Retrieve(id, solver)
 	if err != nil {
-		err := fmt.Errorf("Error fetching solver: %v.  Err: %v", id, err)
+		err := fmt.Errorf("Error fetching solver: %v : %w", id, err)
 		return nil, err
 	}
 
@@ -68,16 +92,21 @@ func (s Solver) getSolverPrototxtContent() ([]byte, error) {
 	// get the relative url path in cbfs (chop off leading cbfs://)
 	sourcePath, err := s.SpecificationUrlPath()
 	if err != nil {
-		return nil, fmt.Errorf("Error getting cbfs path of solver prototxt. Err: %v", err)
+		return nil, fmt.Errorf("Error getting cbfs path of solver prototxt: %w", err)
+	}
+
+	// create a new cbfs-backed fs.FS
+	cbfsFS, err := s.Configuration.NewCbfsFS()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cbfs fs: %w", err)
 	}
 
-	// create a new cbfs client
-	cbfs, err := s.Configuration.NewCbfsClient()
+	content, err := fs.ReadFile(cbfsFS, sourcePath)
 	if err != nil {
-		return nil, fmt.Errorf("Error creating cbfs client: %v", err)
+		return nil, fmt.Errorf("%w: %v: %v", errs.ErrSpecNotFound, sourcePath, err)
 	}
 
-	return getContentFromCbfs(cbfs, sourcePath)
+	return content, nil
 
 }
 
@@ -85,14 +114,14 @@ func (s Solver) getSolverParameter() (*caffe.SolverParameter, error) {
 
 	specContents, err := s.getSolverPrototxtContent()
 	if err != nil {
-		return nil, fmt.Errorf("Error getting solver prototxt content.  Err: %v", err)
+		return nil, fmt.Errorf("Error getting solver prototxt content: %w", err)
 	}
 
 	// read into object with protobuf (must have already generated go protobuf code)
 	solverParam := &caffe.SolverParameter{}
 
 	if err := proto.UnmarshalText(string(specContents), solverParam); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", errs.ErrPrototxtParse, err)
 	}
 
 	return solverParam, nil
@@ -107,13 +136,13 @@ func (s Solver) getModifiedSolverSpec() ([]byte, error) {
 	// read in spec from url -> []byte
 	content, err := getUrlContent(s.SpecificationUrl)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting data: %v.  %v", s.SpecificationUrl, err)
+		return nil, fmt.Errorf("Error getting data: %v : %w", s.SpecificationUrl, err)
 	}
 
 	// pass in []byte to modifier and get modified []byte
 	modified, err := modifySolverSpec(content)
 	if err != nil {
-		return nil, fmt.Errorf("Error modifying: %v.  %v", string(content), err)
+		return nil, fmt.Errorf("%w: %v: %v", errs.ErrPrototxtParse, string(content), err)
 	}
 
 	return modified, nil
@@ -127,13 +156,13 @@ func (s Solver) getModifiedSolverNetSpec() ([]byte, error) {
 	// read in spec from url -> []byte
 	content, err := getUrlContent(s.SpecificationNetUrl)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting data: %v.  %v", s.SpecificationNetUrl, err)
+		return nil, fmt.Errorf("Error getting data: %v : %w", s.SpecificationNetUrl, err)
 	}
 
 	// pass in []byte to modifier and get modified []byte
 	modified, err := modifySolverNetSpec(content)
 	if err != nil {
-		return nil, fmt.Errorf("Error modifying: %v.  %v", string(content), err)
+		return nil, fmt.Errorf("%w: %v: %v", errs.ErrPrototxtParse, string(content), err)
 	}
 
 	return modified, nil
@@ -271,6 +300,33 @@ func (s Solver) DownloadSpecToCbfs(db couch.Database, cbfs *cbfsclient.Client) (
 	return solver, nil
 }
 
+// RewriteSpecs downloads the solver's prototxt specs into cbfs and rewrites
+// s in place, unless the solver has already rewritten its specs on a
+// previous attempt (eg, on a resumed job), in which case it's a no-op.
+//
+// This is gated on s.RewroteSpecs rather than s.isPast(StateRewritingSpecs):
+// nothing guarantees this runs before or after StageTrainTestData, so a
+// total order across the two would be unsafe -- see the comment on
+// jobStateOrder.
+func (s *Solver) RewriteSpecs(db couch.Database, cbfs *cbfsclient.Client) error {
+
+	if s.RewroteSpecs {
+		logg.LogTo("TRAINING_JOB", "Solver %v already rewrote specs, skipping", s.Id)
+		return nil
+	}
+
+	updated, err := s.DownloadSpecToCbfs(db, cbfs)
+	if err != nil {
+		s.transitionState(db, StateFailed, err.Error())
+		return err
+	}
+	*s = *updated
+	s.RewroteSpecs = true
+
+	return s.transitionState(db, StateRewritingSpecs, "")
+
+}
+
 func (s Solver) saveToCbfs(cbfs *cbfsclient.Client, destPath string, reader io.Reader) error {
 
 	// save to cbfs
@@ -279,7 +335,7 @@ func (s Solver) saveToCbfs(cbfs *cbfsclient.Client, destPath string, reader io.R
 	}
 
 	if err := cbfs.Put("", destPath, reader, options); err != nil {
-		return fmt.Errorf("Error writing %v to cbfs: %v", destPath, err)
+		return fmt.Errorf("%w: writing %v to cbfs: %v", errs.ErrCbfsUnavailable, destPath, err)
 	}
 	logg.LogTo("REST", "Wrote %v to cbfs", destPath)
 	return nil
@@ -291,7 +347,7 @@ func (s Solver) saveUrlToCbfs(cbfs *cbfsclient.Client, destPath, sourceUrl strin
 	// open stream to source url
 	resp, err := http.Get(sourceUrl)
 	if err != nil {
-		return fmt.Errorf("Error doing GET on: %v.  %v", sourceUrl, err)
+		return fmt.Errorf("Error doing GET on: %v : %w", sourceUrl, err)
 	}
 	defer resp.Body.Close()
 
@@ -353,36 +409,104 @@ func (s Solver) writeCbfsFile(config Configuration, destDirectory, sourceUrl str
 	// get filename, eg, if path is foo/spec.txt, get spec.txt
 	_, sourceFilename := filepath.Split(sourceUrl)
 
-	// use cbfs client to open stream
-
-	cbfs, err := cbfsclient.New(config.CbfsUrl)
+	// use a cbfs-backed fs.FS to open a stream
+	cbfsFS, err := config.NewCbfsFS()
 	if err != nil {
 		return err
 	}
 
-	// get from cbfs
 	logg.LogTo("TRAINING_JOB", "Cbfs get %v", sourceUrl)
-	reader, err := cbfs.Get(sourceUrl)
-	if err != nil {
+	if err := copyFsFileToDir(cbfsFS, sourceUrl, destDirectory); err != nil {
 		return err
 	}
 
-	// write stream to file in work directory
-	destPath := filepath.Join(destDirectory, sourceFilename)
-	f, err := os.Create(destPath)
-	if err != nil {
+	logg.LogTo("TRAINING_JOB", "Wrote to %v", filepath.Join(destDirectory, sourceFilename))
+
+	return nil
+
+}
+
+// copyFsFileToDir walks root (a file or a directory in srcFS) and copies
+// every regular file it finds into destDirectory, preserving the path
+// relative to root.  writeCbfsFile uses it; SaveTrainTestData does not, and
+// instead opens each training/testing artifact and untars it itself.  It
+// works unmodified against any fs.FS -- cbfs-backed, an overlay, or an
+// fstest.MapFS in tests.
+func copyFsFileToDir(srcFS fs.FS, root, destDirectory string) error {
+
+	return fs.WalkDir(srcFS, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			// root itself is a single file, not a directory -- keep its
+			// basename instead of collapsing destPath to destDirectory.
+			rel = filepath.Base(root)
+		}
+
+		destPath := filepath.Join(destDirectory, rel)
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+
+		srcFile, err := srcFS.Open(p)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+
+		destFile, err := os.Create(destPath)
+		if err != nil {
+			return err
+		}
+		defer destFile.Close()
+
+		w := bufio.NewWriter(destFile)
+		defer w.Flush()
+		_, err = io.Copy(w, srcFile)
 		return err
+	})
+
+}
+
+// StageTrainTestData runs SaveTrainTestData and persists its resulting label
+// index onto s, unless the solver has already staged train/test data on a
+// previous attempt (eg, on a resumed job), in which case it reuses the
+// previously persisted TrainingLabelIndex instead of re-untaring the cbfs
+// artifacts.
+//
+// This is gated on s.StagedTrainTestData rather than
+// s.isPast(StateStagingData): nothing guarantees this runs before or after
+// RewriteSpecs, so a total order across the two would be unsafe -- see the
+// comment on jobStateOrder.
+func (s *Solver) StageTrainTestData(db couch.Database, config Configuration, destDirectory string) ([]string, error) {
+
+	if s.StagedTrainTestData {
+		logg.LogTo("TRAINING_JOB", "Solver %v already staged train/test data, reusing persisted label index", s.Id)
+		return s.TrainingLabelIndex, nil
 	}
-	w := bufio.NewWriter(f)
-	defer w.Flush()
-	_, err = io.Copy(w, reader)
+
+	labelIndex, err := s.SaveTrainTestData(config, destDirectory)
 	if err != nil {
-		return err
+		s.transitionState(db, StateFailed, err.Error())
+		return nil, err
 	}
+	s.TrainingLabelIndex = labelIndex
+	s.StagedTrainTestData = true
 
-	logg.LogTo("TRAINING_JOB", "Wrote to %v", destPath)
+	if err := s.transitionState(db, StateStagingData, ""); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return labelIndex, nil
 
 }
 
@@ -401,20 +525,20 @@ func (s Solver) SaveTrainTestData(config Configuration, destDirectory string) ([
 	trainingLabelIndex := []string{}
 	// TODO: testLabelIndex := []string{}
 
+	// create a cbfs-backed fs.FS
+	cbfsFS, err := config.NewCbfsFS()
+	if err != nil {
+		return nil, err
+	}
+
 	artificactPaths := []string{trainingArtifact, testArtifact}
 	for _, artificactPath := range artificactPaths {
 
-		// create cbfs client
-		cbfs, err := cbfsclient.New(config.CbfsUrl)
-		if err != nil {
-			return nil, err
-		}
-
 		// open stream to artifact in cbfs
 		logg.LogTo("TRAINING_JOB", "Cbfs get %v", artificactPath)
-		reader, err := cbfs.Get(artificactPath)
+		reader, err := cbfsFS.Open(artificactPath)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: %v: %v", errs.ErrDatasetArtifactMissing, artificactPath, err)
 		}
 		defer reader.Close()
 
@@ -570,25 +694,27 @@ func addLabelsToToc(tableOfContents []string) ([]string, []string) {
 
 }
 
-// If spefication url is "cbfs://foo/bar.txt", return "/foo/bar.txt"
-func (s Solver) SpecificationUrlPath() (string, error) {
+// cbfsUriPath chops the leading cbfs:// off of a cbfs url, eg turns
+// "cbfs://foo/bar.txt" into "foo/bar.txt".  Returns errs.ErrInvalidCbfsURI
+// if url isn't a cbfs:// uri.
+func cbfsUriPath(url string) (string, error) {
 
-	specUrl := s.SpecificationUrl
-	if !strings.HasPrefix(specUrl, CBFS_URI_PREFIX) {
-		return "", fmt.Errorf("Expected %v to start with %v", specUrl, CBFS_URI_PREFIX)
+	if !strings.HasPrefix(url, CBFS_URI_PREFIX) {
+		return "", fmt.Errorf("%w: %v", errs.ErrInvalidCbfsURI, url)
 	}
 
-	return strings.Replace(specUrl, CBFS_URI_PREFIX, "", 1), nil
+	return strings.Replace(url, CBFS_URI_PREFIX, "", 1), nil
 
 }
 
-func (s Solver) SpecificationNetUrlPath() (string, error) {
-
-	specUrl := s.SpecificationNetUrl
-	if !strings.HasPrefix(specUrl, CBFS_URI_PREFIX) {
-		return "", fmt.Errorf("Expected %v to start with %v", specUrl, CBFS_URI_PREFIX)
-	}
-
-	return strings.Replace(specUrl, CBFS_URI_PREFIX, "", 1), nil
+// SpecificationUrlPath chops the leading cbfs:// off of SpecificationUrl,
+// eg "cbfs://foo/bar.txt" becomes "foo/bar.txt".
+func (s Solver) SpecificationUrlPath() (string, error) {
+	return cbfsUriPath(s.SpecificationUrl)
+}
 
+// SpecificationNetUrlPath chops the leading cbfs:// off of
+// SpecificationNetUrl, eg "cbfs://foo/bar.txt" becomes "foo/bar.txt".
+func (s Solver) SpecificationNetUrlPath() (string, error) {
+	return cbfsUriPath(s.SpecificationNetUrl)
 }